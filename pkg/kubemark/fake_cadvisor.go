@@ -0,0 +1,208 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cadvisorapi "github.com/google/cadvisor/info/v1"
+	cadvisorapiv2 "github.com/google/cadvisor/info/v2"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/kubelet/cadvisor"
+)
+
+// PodLister is the minimal view of currently admitted pods the fake cadvisor
+// (and the /metrics handler) need in order to synthesize believable stats.
+type PodLister interface {
+	GetPods() []*v1.Pod
+}
+
+// hollowPodLister is the default PodLister: a thread-safe snapshot of pods
+// that HollowKubelet.syncPodLister refreshes periodically from the pods
+// bound to this node in the API server, in lieu of the real pod manager's
+// cache.
+type hollowPodLister struct {
+	mu   sync.RWMutex
+	pods []*v1.Pod
+}
+
+func newHollowPodLister() *hollowPodLister {
+	return &hollowPodLister{}
+}
+
+// SetPods replaces the current snapshot of known pods.
+func (l *hollowPodLister) SetPods(pods []*v1.Pod) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pods = pods
+}
+
+func (l *hollowPodLister) GetPods() []*v1.Pod {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.pods
+}
+
+// fakeCadvisor is a cadvisor.Interface that never touches cgroups or the
+// real host; it synthesizes CPU/memory/network/fs usage for each hollow pod
+// from that pod's resource requests so that HPA, VPA and metrics-server can
+// be scale-tested against a kubemark cluster.
+type fakeCadvisor struct {
+	pods PodLister
+}
+
+// NewFakeCadvisor returns a cadvisor.Interface backed by the given pod
+// lister. It is wired into kubelet.Dependencies.CAdvisorInterface by
+// NewHollowKubelet in place of the previous passthrough implementation.
+func NewFakeCadvisor(pods PodLister) cadvisor.Interface {
+	return &fakeCadvisor{pods: pods}
+}
+
+func (fc *fakeCadvisor) Start() error { return nil }
+
+func (fc *fakeCadvisor) MachineInfo() (*cadvisorapi.MachineInfo, error) {
+	return &cadvisorapi.MachineInfo{
+		NumCores:       32,
+		MemoryCapacity: 128 * 1024 * 1024 * 1024,
+	}, nil
+}
+
+func (fc *fakeCadvisor) VersionInfo() (*cadvisorapi.VersionInfo, error) {
+	return &cadvisorapi.VersionInfo{KernelVersion: "fake", ContainerOsVersion: "fake"}, nil
+}
+
+func (fc *fakeCadvisor) ImagesFsInfo() (cadvisorapiv2.FsInfo, error) {
+	return fc.fakeFsInfo(), nil
+}
+
+func (fc *fakeCadvisor) RootFsInfo() (cadvisorapiv2.FsInfo, error) {
+	return fc.fakeFsInfo(), nil
+}
+
+func (fc *fakeCadvisor) GetDirFsInfo(path string) (cadvisorapiv2.FsInfo, error) {
+	return fc.fakeFsInfo(), nil
+}
+
+func (fc *fakeCadvisor) fakeFsInfo() cadvisorapiv2.FsInfo {
+	const capacity = 100 * 1024 * 1024 * 1024
+	used := fc.aggregateEphemeralStorageUsage()
+	return cadvisorapiv2.FsInfo{
+		Capacity:  capacity,
+		Usage:     used,
+		Available: capacity - used,
+	}
+}
+
+func (fc *fakeCadvisor) ContainerInfo(name string, req *cadvisorapi.ContainerInfoRequest) (*cadvisorapi.ContainerInfo, error) {
+	return nil, fmt.Errorf("fakeCadvisor: ContainerInfo(%s) not implemented, use ContainerInfoV2", name)
+}
+
+func (fc *fakeCadvisor) ContainerInfoV2(name string, options cadvisorapiv2.RequestOptions) (map[string]cadvisorapiv2.ContainerInfo, error) {
+	result := make(map[string]cadvisorapiv2.ContainerInfo)
+	for _, pod := range fc.pods.GetPods() {
+		for i, c := range pod.Spec.Containers {
+			key := fmt.Sprintf("/pod%s/%s/%s", pod.Namespace, pod.Name, c.Name)
+			result[key] = fc.containerStatsFor(pod, &pod.Spec.Containers[i])
+		}
+	}
+	return result, nil
+}
+
+// splitContainerInfoKey reverses the "/pod<namespace>/<name>/<container>" key
+// format used by ContainerInfoV2, so callers (the /metrics collector) can
+// label series by pod name and container identity -- the identifiers scale
+// tests like HPA, VPA and metrics-server actually match on -- instead of the
+// composite key.
+func splitContainerInfoKey(key string) (podName, container string) {
+	parts := strings.SplitN(strings.TrimPrefix(key, "/pod"), "/", 3)
+	if len(parts) != 3 {
+		return key, ""
+	}
+	return parts[1], parts[2]
+}
+
+func (fc *fakeCadvisor) SubcontainerInfo(name string, req *cadvisorapi.ContainerInfoRequest) (map[string]*cadvisorapi.ContainerInfo, error) {
+	return map[string]*cadvisorapi.ContainerInfo{}, nil
+}
+
+func (fc *fakeCadvisor) GetRequestedContainersInfo(containerName string, options cadvisorapiv2.RequestOptions) (map[string]*cadvisorapi.ContainerInfo, error) {
+	return map[string]*cadvisorapi.ContainerInfo{}, nil
+}
+
+// containerStatsFor synthesizes a single sample of usage for container c,
+// pinned at roughly 60% of its CPU/memory requests (falling back to limits,
+// then a small fixed default) so downstream autoscalers see plausible,
+// non-zero utilization.
+func (fc *fakeCadvisor) containerStatsFor(pod *v1.Pod, c *v1.Container) cadvisorapiv2.ContainerInfo {
+	const utilizationFraction = 0.6
+
+	cpuRequest := requestOrLimit(c, v1.ResourceCPU, resource.MustParse("100m"))
+	memRequest := requestOrLimit(c, v1.ResourceMemory, resource.MustParse("100Mi"))
+
+	cpuUsageNanos := uint64(float64(cpuRequest.MilliValue()) * utilizationFraction * 1e6)
+	memUsageBytes := uint64(float64(memRequest.Value()) * utilizationFraction)
+
+	return cadvisorapiv2.ContainerInfo{
+		Spec: cadvisorapiv2.ContainerSpec{
+			CreationTime:  pod.CreationTimestamp.Time,
+			HasCpu:        true,
+			HasMemory:     true,
+			HasNetwork:    true,
+			HasFilesystem: true,
+		},
+		Stats: []*cadvisorapiv2.ContainerStats{
+			{
+				Timestamp: time.Now(),
+				Cpu:       cadvisorapi.CpuStats{Usage: cadvisorapi.CpuUsage{Total: cpuUsageNanos}},
+				Memory:    cadvisorapi.MemoryStats{Usage: memUsageBytes, WorkingSet: memUsageBytes},
+				Network: cadvisorapiv2.NetworkStats{
+					Interfaces: []cadvisorapi.InterfaceStats{{Name: "eth0", RxBytes: 1024, TxBytes: 1024}},
+				},
+			},
+		},
+	}
+}
+
+// requestOrLimit returns c's Requests[name] if set, else its Limits[name],
+// else def.
+func requestOrLimit(c *v1.Container, name v1.ResourceName, def resource.Quantity) resource.Quantity {
+	if q, ok := c.Resources.Requests[name]; ok {
+		return q
+	}
+	if q, ok := c.Resources.Limits[name]; ok {
+		return q
+	}
+	return def
+}
+
+// aggregateEphemeralStorageUsage sums a synthetic ephemeral-storage usage
+// across all hollow pods, used to drive RootFsInfo/ImagesFsInfo.
+func (fc *fakeCadvisor) aggregateEphemeralStorageUsage() uint64 {
+	var total uint64
+	for _, pod := range fc.pods.GetPods() {
+		for _, c := range pod.Spec.Containers {
+			q := requestOrLimit(&c, v1.ResourceEphemeralStorage, resource.MustParse("1Mi"))
+			total += uint64(q.Value())
+		}
+	}
+	return total
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSplitContainerInfoKey(t *testing.T) {
+	podName, container := splitContainerInfoKey("/poddefault/my-pod/my-container")
+	if podName != "my-pod" || container != "my-container" {
+		t.Errorf("got (%q, %q), want (\"my-pod\", \"my-container\")", podName, container)
+	}
+}
+
+func TestHollowPodListerSetPodsIsVisibleToContainerInfoV2(t *testing.T) {
+	lister := newHollowPodLister()
+	fc := NewFakeCadvisor(lister)
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{UID: types.UID("uid-1"), Name: "my-pod", Namespace: "default"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "c"}},
+		},
+	}
+	lister.SetPods([]*v1.Pod{pod})
+
+	infos, err := fc.ContainerInfoV2("/", cadvisorV2RequestOptions)
+	if err != nil {
+		t.Fatalf("ContainerInfoV2: %v", err)
+	}
+	if _, ok := infos["/poddefault/my-pod/c"]; !ok {
+		t.Errorf("expected ContainerInfoV2 to report the pod set via SetPods, got %v", infos)
+	}
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	internalapi "k8s.io/cri-api/pkg/apis"
+	"k8s.io/kubernetes/pkg/kubelet/cm"
+	"k8s.io/kubernetes/pkg/kubelet/status"
+)
+
+// cpuAllocation records which simulated CPU cores, on which NUMA node, a
+// container was pinned to by the static-policy-like logic below, along with
+// the owning pod's name/namespace so the podresources API can report them
+// back without having to resolve a UID through the API server.
+type cpuAllocation struct {
+	podName      string
+	podNamespace string
+	numaNode     int
+	cpuIDs       []int
+}
+
+// fakeContainerManager is a cm.ContainerManager that models NUMA topology
+// and CPU manager ("static" policy) pinning decisions for hollow pods,
+// instead of touching real cgroups or hardware. Hugepages and devices from
+// the topology are reported as node capacity only; no memory, hugepage or
+// device reservation is made per pod. It implements the subset of the
+// interface the hollow kubelet's sync path and the podresources API need;
+// cgroup-management methods are no-ops since there is no real container
+// underneath.
+type fakeContainerManager struct {
+	topology *NodeTopology
+
+	mu sync.Mutex
+	// freeCPUs[i] holds the free core indices on NUMA node i, in ascending
+	// order, available to hand out via allocateCPUsLocked.
+	freeCPUs [][]int
+	// allocations maps "<pod UID>/<container name>" to its pinned cores,
+	// and is what the podresources API reports back.
+	allocations map[string]cpuAllocation
+}
+
+// NewFakeContainerManager returns a cm.ContainerManager simulating the given
+// node topology's NUMA-aware CPU and memory manager behavior. A nil
+// topology falls back to DefaultNodeTopology.
+func NewFakeContainerManager(topology *NodeTopology) cm.ContainerManager {
+	if topology == nil {
+		topology = DefaultNodeTopology()
+	}
+	freeCPUs := make([][]int, len(topology.NUMANodes))
+	for node, n := range topology.NUMANodes {
+		ids := make([]int, n.CoreCount)
+		for i := range ids {
+			ids[i] = i
+		}
+		freeCPUs[node] = ids
+	}
+	return &fakeContainerManager{
+		topology:    topology,
+		freeCPUs:    freeCPUs,
+		allocations: make(map[string]cpuAllocation),
+	}
+}
+
+func (fcm *fakeContainerManager) Start(*v1.Node, cm.ActivePodsFunc, status.PodStatusProvider, internalapi.RuntimeService, bool) error {
+	return nil
+}
+
+func (fcm *fakeContainerManager) SystemCgroupsLimit() v1.ResourceList {
+	return v1.ResourceList{}
+}
+
+func (fcm *fakeContainerManager) GetNodeConfig() cm.NodeConfig {
+	return cm.NodeConfig{}
+}
+
+func (fcm *fakeContainerManager) GetMountedSubsystems() *cm.CgroupSubsystems {
+	return &cm.CgroupSubsystems{}
+}
+
+func (fcm *fakeContainerManager) GetQOSContainersInfo() cm.QOSContainersInfo {
+	return cm.QOSContainersInfo{}
+}
+
+func (fcm *fakeContainerManager) GetNodeAllocatableReservation() v1.ResourceList {
+	return v1.ResourceList{}
+}
+
+// GetCapacity reports the simulated node's total CPU and hugepages-2Mi
+// capacity, derived from the configured NodeTopology. It has no memory
+// entry.
+func (fcm *fakeContainerManager) GetCapacity() v1.ResourceList {
+	capacity := v1.ResourceList{
+		v1.ResourceCPU: *resource.NewQuantity(int64(fcm.topology.TotalCores()), resource.DecimalSI),
+	}
+	var hugepagesMB int64
+	for _, n := range fcm.topology.NUMANodes {
+		hugepagesMB += n.HugepagesMB
+	}
+	if hugepagesMB > 0 {
+		capacity[v1.ResourceName("hugepages-2Mi")] = *resource.NewQuantity(hugepagesMB*1024*1024, resource.BinarySI)
+	}
+	return capacity
+}
+
+// GetDevicePluginResourceCapacity reports the simulated node's extended
+// resources, aggregated across all NUMA nodes.
+func (fcm *fakeContainerManager) GetDevicePluginResourceCapacity() (v1.ResourceList, v1.ResourceList, []string) {
+	capacity := v1.ResourceList{}
+	for _, n := range fcm.topology.NUMANodes {
+		for _, d := range n.Devices {
+			name := v1.ResourceName(d.ResourceName)
+			q := capacity[name]
+			q.Add(*resource.NewQuantity(int64(d.Count), resource.DecimalSI))
+			capacity[name] = q
+		}
+	}
+	return capacity, capacity.DeepCopy(), nil
+}
+
+func (fcm *fakeContainerManager) NewPodContainerManager() cm.PodContainerManager {
+	return &fakePodContainerManager{}
+}
+
+// GetResources implements the CPU-manager "static" policy: Guaranteed-QoS
+// containers requesting whole CPUs are pinned to the next free cores on a
+// single NUMA node, recorded so the podresources API can report them back.
+// Memory and hugepage requests are not reserved against any NUMA node.
+func (fcm *fakeContainerManager) GetResources(pod *v1.Pod, container *v1.Container, _ []*v1.Pod) (*cm.RunContainerOptions, error) {
+	fcm.mu.Lock()
+	defer fcm.mu.Unlock()
+
+	if cpuRequest, ok := container.Resources.Requests[v1.ResourceCPU]; ok && isGuaranteed(pod) && cpuRequest.MilliValue()%1000 == 0 {
+		numCPUs := int(cpuRequest.Value())
+		numaNode, cpuIDs, err := fcm.allocateCPUsLocked(numCPUs)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%s/%s", pod.UID, container.Name)
+		fcm.allocations[key] = cpuAllocation{
+			podName:      pod.Name,
+			podNamespace: pod.Namespace,
+			numaNode:     numaNode,
+			cpuIDs:       cpuIDs,
+		}
+	}
+	return &cm.RunContainerOptions{}, nil
+}
+
+// allocateCPUsLocked hands out numCPUs consecutive free cores from the first
+// NUMA node with enough free capacity. Callers must hold fcm.mu.
+func (fcm *fakeContainerManager) allocateCPUsLocked(numCPUs int) (int, []int, error) {
+	for node, free := range fcm.freeCPUs {
+		if len(free) >= numCPUs {
+			cpuIDs := append([]int(nil), free[:numCPUs]...)
+			fcm.freeCPUs[node] = free[numCPUs:]
+			return node, cpuIDs, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("not enough free CPUs to satisfy a %d-core exclusive allocation", numCPUs)
+}
+
+// ReleasePod frees any CPUs pinned to podUID's containers, so they can be
+// handed back out to a later pod. Since kubemark's fake CRI only identifies
+// containers by an opaque ID with no link back to the owning pod/container
+// name (unlike a real runtime's internal container cache, which is what
+// PostStopContainer normally consults), release is driven by pod churn
+// observed via the pod lister instead of the PostStopContainer hook.
+func (fcm *fakeContainerManager) ReleasePod(podUID types.UID) {
+	fcm.mu.Lock()
+	defer fcm.mu.Unlock()
+	prefix := string(podUID) + "/"
+	for key, alloc := range fcm.allocations {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		fcm.freeCPUs[alloc.numaNode] = append(fcm.freeCPUs[alloc.numaNode], alloc.cpuIDs...)
+		sort.Ints(fcm.freeCPUs[alloc.numaNode])
+		delete(fcm.allocations, key)
+	}
+}
+
+// Allocations returns a snapshot of the current pod/container CPU pinning,
+// for the podresources gRPC server to report.
+func (fcm *fakeContainerManager) Allocations() map[string]cpuAllocation {
+	fcm.mu.Lock()
+	defer fcm.mu.Unlock()
+	out := make(map[string]cpuAllocation, len(fcm.allocations))
+	for k, v := range fcm.allocations {
+		out[k] = v
+	}
+	return out
+}
+
+// isGuaranteed reports whether pod is Guaranteed QoS, mirroring
+// qos.GetPodQOS: every container must request at least CPU and memory, and
+// every resource it requests must have an equal limit. A container with no
+// requests or limits at all is BestEffort, not vacuously Guaranteed.
+func isGuaranteed(pod *v1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		cpu, ok := c.Resources.Requests[v1.ResourceCPU]
+		if !ok || c.Resources.Limits[v1.ResourceCPU].Cmp(cpu) != 0 {
+			return false
+		}
+		mem, ok := c.Resources.Requests[v1.ResourceMemory]
+		if !ok || c.Resources.Limits[v1.ResourceMemory].Cmp(mem) != 0 {
+			return false
+		}
+		for name, request := range c.Resources.Requests {
+			limit, ok := c.Resources.Limits[name]
+			if !ok || limit.Cmp(request) != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (fcm *fakeContainerManager) UpdateQOSCgroups() error { return nil }
+
+func (fcm *fakeContainerManager) Status() cm.Status { return cm.Status{} }
+
+func (fcm *fakeContainerManager) GetNodeAllocatableAbsolute() v1.ResourceList {
+	return fcm.GetCapacity()
+}
+
+func (fcm *fakeContainerManager) GetPodCgroupRoot() string { return "" }
+
+func (fcm *fakeContainerManager) ShouldResetExtendedResourceCapacity() bool { return false }
+
+func (fcm *fakeContainerManager) InternalContainerLifecycle() cm.InternalContainerLifecycle {
+	return &fakeInternalContainerLifecycle{}
+}
+
+// fakeInternalContainerLifecycle is a no-op hook; the hollow runtime has no
+// real container to apply CPU-set/cgroup decisions to.
+type fakeInternalContainerLifecycle struct{}
+
+func (fakeInternalContainerLifecycle) PreCreateContainer(pod *v1.Pod, container *v1.Container, containerConfig interface{}) error {
+	return nil
+}
+func (fakeInternalContainerLifecycle) PreStartContainer(pod *v1.Pod, container *v1.Container, containerID string) error {
+	return nil
+}
+// PostStopContainer is a no-op: containerID alone isn't enough to find the
+// owning pod/container in fcm.allocations, so CPU release is instead driven
+// by pod churn; see fakeContainerManager.ReleasePod.
+func (fakeInternalContainerLifecycle) PostStopContainer(containerID string) error { return nil }
+
+// fakePodContainerManager is a no-op cm.PodContainerManager; hollow pods
+// have no real cgroup hierarchy to manage.
+type fakePodContainerManager struct{}
+
+func (*fakePodContainerManager) Exists(_ *v1.Pod) bool        { return true }
+func (*fakePodContainerManager) EnsureExists(_ *v1.Pod) error { return nil }
+func (*fakePodContainerManager) GetPodContainerName(pod *v1.Pod) (cm.CgroupName, string) {
+	return cm.CgroupName{string(pod.UID)}, string(pod.UID)
+}
+func (*fakePodContainerManager) Destroy(_ cm.CgroupName) error          { return nil }
+func (*fakePodContainerManager) ReduceCPULimits(_ cm.CgroupName) error  { return nil }
+func (*fakePodContainerManager) IsPodCgroup(_ string) (bool, types.UID) { return false, "" }
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func guaranteedContainer(name string, cpu string) v1.Container {
+	q := resource.MustParse(cpu)
+	return v1.Container{
+		Name: name,
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: q, v1.ResourceMemory: resource.MustParse("100Mi")},
+			Limits:   v1.ResourceList{v1.ResourceCPU: q, v1.ResourceMemory: resource.MustParse("100Mi")},
+		},
+	}
+}
+
+func TestIsGuaranteed(t *testing.T) {
+	cases := []struct {
+		name string
+		pod  *v1.Pod
+		want bool
+	}{
+		{
+			name: "matching requests and limits is Guaranteed",
+			pod:  &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{guaranteedContainer("c", "2")}}},
+			want: true,
+		},
+		{
+			name: "no requests or limits at all is not Guaranteed",
+			pod:  &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "c"}}}},
+			want: false,
+		},
+		{
+			name: "mismatched cpu request/limit is Burstable, not Guaranteed",
+			pod: &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{
+				Name: "c",
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+					Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+				},
+			}}}},
+			want: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isGuaranteed(tc.pod); got != tc.want {
+				t.Errorf("isGuaranteed() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAllocateCPUsLockedReleasesBackToFreeList(t *testing.T) {
+	fcm := NewFakeContainerManager(&NodeTopology{
+		NUMANodes: []NUMANodeTopology{{CoreCount: 2}},
+	}).(*fakeContainerManager)
+
+	pod1 := &v1.Pod{ObjectMeta: metav1.ObjectMeta{UID: types.UID("pod-1")}}
+	container := guaranteedContainer("c", "2")
+	if _, err := fcm.GetResources(pod1, &container, nil); err != nil {
+		t.Fatalf("GetResources for pod-1: %v", err)
+	}
+
+	pod2 := &v1.Pod{ObjectMeta: metav1.ObjectMeta{UID: types.UID("pod-2")}}
+	if _, err := fcm.GetResources(pod2, &container, nil); err == nil {
+		t.Fatalf("expected GetResources for pod-2 to fail while pod-1 holds all cores")
+	}
+
+	fcm.ReleasePod(pod1.UID)
+
+	if _, err := fcm.GetResources(pod2, &container, nil); err != nil {
+		t.Fatalf("GetResources for pod-2 after releasing pod-1: %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	runtimeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// simContainer wraps the CRI-visible Container with the extra bookkeeping
+// the PodSimulator needs to decide its current state: the pod it belongs to
+// (reconstructed from CRI sandbox metadata, since the CRI wire format has no
+// notion of a full v1.Pod), when it was created, and whether a caller
+// explicitly stopped it (which overrides whatever the simulator would have
+// said next).
+type simContainer struct {
+	*runtimeapi.Container
+	pod       *v1.Pod
+	createdAt time.Time
+	stopped   bool
+}
+
+// fakeCRIServer is an in-process CRI implementation used in place of
+// dockershim so that kubemark exercises the same RuntimeService/ImageService
+// code paths real nodes do against containerd or CRI-O. It keeps all pod
+// sandbox, container and image state in memory; nothing ever touches an
+// actual container runtime. It implements the subset of the CRI v1alpha2
+// RPCs the kubelet's generic runtime manager and image manager call during
+// normal pod sync; streaming (exec/attach/port-forward) and stats RPCs are
+// not needed by kubemark and are left to the embedding grpc.Server to reject
+// as unimplemented.
+//
+// Container state transitions (image-pull latency, start delay, OOM kills)
+// are not applied eagerly; they are computed on demand from simulator by
+// currentState, so that ListContainers/ContainerStatus always reflect
+// however much simulated time has elapsed since the container was created.
+type fakeCRIServer struct {
+	mu sync.Mutex
+
+	sandboxes   map[string]*runtimeapi.PodSandbox
+	sandboxPods map[string]*v1.Pod
+	containers  map[string]*simContainer
+	images      map[string]*runtimeapi.Image
+
+	simulator PodSimulator
+	nextID    uint64
+}
+
+func newFakeCRIServer(simulator PodSimulator) *fakeCRIServer {
+	if simulator == nil {
+		simulator = NewPodSimulator(nil)
+	}
+	return &fakeCRIServer{
+		sandboxes:   make(map[string]*runtimeapi.PodSandbox),
+		sandboxPods: make(map[string]*v1.Pod),
+		containers:  make(map[string]*simContainer),
+		images:      make(map[string]*runtimeapi.Image),
+		simulator:   simulator,
+	}
+}
+
+// genID returns a unique, monotonically increasing fake object ID. Callers
+// hold s.mu.
+func (s *fakeCRIServer) genID() string {
+	s.nextID++
+	return fmt.Sprintf("fakecri-%d", s.nextID)
+}
+
+// StartFakeCRIServer starts an in-process gRPC server implementing the CRI
+// RuntimeService and ImageService on socketPath, for use as the hollow
+// kubelet's RemoteRuntimeEndpoint/RemoteImageEndpoint. Container state
+// transitions (image-pull latency, start delay, OOM kills, ...) are driven
+// by simulator; a nil simulator behaves like an always-on, always-successful
+// runtime. It returns immediately; the server runs until the process exits.
+func StartFakeCRIServer(socketPath string, simulator PodSimulator) error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clean up existing socket %q: %v", socketPath, err)
+	}
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %q: %v", socketPath, err)
+	}
+
+	s := newFakeCRIServer(simulator)
+	server := grpc.NewServer()
+	runtimeapi.RegisterRuntimeServiceServer(server, s)
+	runtimeapi.RegisterImageServiceServer(server, s)
+
+	go func() {
+		if err := server.Serve(l); err != nil {
+			klog.Fatalf("Fake CRI server exited: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *fakeCRIServer) Version(ctx context.Context, req *runtimeapi.VersionRequest) (*runtimeapi.VersionResponse, error) {
+	return &runtimeapi.VersionResponse{
+		Version:           "0.1.0",
+		RuntimeName:       "fakecri",
+		RuntimeVersion:    "0.1.0",
+		RuntimeApiVersion: "v1alpha2",
+	}, nil
+}
+
+func (s *fakeCRIServer) RunPodSandbox(ctx context.Context, req *runtimeapi.RunPodSandboxRequest) (*runtimeapi.RunPodSandboxResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.genID()
+	s.sandboxes[id] = &runtimeapi.PodSandbox{
+		Id:          id,
+		Metadata:    req.Config.Metadata,
+		State:       runtimeapi.PodSandboxState_SANDBOX_READY,
+		Labels:      req.Config.Labels,
+		Annotations: req.Config.Annotations,
+	}
+	s.sandboxPods[id] = podFromSandboxConfig(req.Config)
+	return &runtimeapi.RunPodSandboxResponse{PodSandboxId: id}, nil
+}
+
+// podFromSandboxConfig reconstructs just enough of a v1.Pod from CRI sandbox
+// metadata/labels for PodSimulator's label-selector matching; CreateContainer
+// later adds each container's name and image for image matching. The CRI
+// wire format carries no full PodSpec, so this is necessarily a projection,
+// not a faithful copy of the real pod.
+func podFromSandboxConfig(config *runtimeapi.PodSandboxConfig) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      config.Metadata.Name,
+			Namespace: config.Metadata.Namespace,
+			UID:       types.UID(config.Metadata.Uid),
+			Labels:    config.Labels,
+		},
+	}
+}
+
+func (s *fakeCRIServer) StopPodSandbox(ctx context.Context, req *runtimeapi.StopPodSandboxRequest) (*runtimeapi.StopPodSandboxResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sb, ok := s.sandboxes[req.PodSandboxId]; ok {
+		sb.State = runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+	}
+	return &runtimeapi.StopPodSandboxResponse{}, nil
+}
+
+func (s *fakeCRIServer) RemovePodSandbox(ctx context.Context, req *runtimeapi.RemovePodSandboxRequest) (*runtimeapi.RemovePodSandboxResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sandboxes, req.PodSandboxId)
+	delete(s.sandboxPods, req.PodSandboxId)
+	return &runtimeapi.RemovePodSandboxResponse{}, nil
+}
+
+func (s *fakeCRIServer) PodSandboxStatus(ctx context.Context, req *runtimeapi.PodSandboxStatusRequest) (*runtimeapi.PodSandboxStatusResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sb, ok := s.sandboxes[req.PodSandboxId]
+	if !ok {
+		return nil, fmt.Errorf("no such pod sandbox %q", req.PodSandboxId)
+	}
+	return &runtimeapi.PodSandboxStatusResponse{
+		Status: &runtimeapi.PodSandboxStatus{
+			Id:       sb.Id,
+			Metadata: sb.Metadata,
+			State:    sb.State,
+		},
+	}, nil
+}
+
+func (s *fakeCRIServer) ListPodSandbox(ctx context.Context, req *runtimeapi.ListPodSandboxRequest) (*runtimeapi.ListPodSandboxResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]*runtimeapi.PodSandbox, 0, len(s.sandboxes))
+	for _, sb := range s.sandboxes {
+		items = append(items, sb)
+	}
+	return &runtimeapi.ListPodSandboxResponse{Items: items}, nil
+}
+
+func (s *fakeCRIServer) CreateContainer(ctx context.Context, req *runtimeapi.CreateContainerRequest) (*runtimeapi.CreateContainerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.genID()
+	// Record the container's image on the sandbox's pod projection so
+	// PodSimulator's image matching sees it.
+	if pod := s.sandboxPods[req.PodSandboxId]; pod != nil && req.Config.Image != nil {
+		pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: req.Config.Metadata.Name, Image: req.Config.Image.Image})
+	}
+	s.containers[id] = &simContainer{
+		Container: &runtimeapi.Container{
+			Id:           id,
+			PodSandboxId: req.PodSandboxId,
+			Metadata:     req.Config.Metadata,
+			Image:        req.Config.Image,
+			State:        runtimeapi.ContainerState_CONTAINER_CREATED,
+			Labels:       req.Config.Labels,
+			Annotations:  req.Config.Annotations,
+		},
+		pod:       s.sandboxPods[req.PodSandboxId],
+		createdAt: time.Now(),
+	}
+	return &runtimeapi.CreateContainerResponse{ContainerId: id}, nil
+}
+
+// StartContainer is a no-op: the container's simulated state is computed on
+// demand from its creation time by currentState, so there is nothing to
+// flip here beyond what CreateContainer already recorded.
+func (s *fakeCRIServer) StartContainer(ctx context.Context, req *runtimeapi.StartContainerRequest) (*runtimeapi.StartContainerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.containers[req.ContainerId]; !ok {
+		return nil, fmt.Errorf("no such container %q", req.ContainerId)
+	}
+	return &runtimeapi.StartContainerResponse{}, nil
+}
+
+func (s *fakeCRIServer) StopContainer(ctx context.Context, req *runtimeapi.StopContainerRequest) (*runtimeapi.StopContainerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.containers[req.ContainerId]; ok {
+		c.stopped = true
+	}
+	return &runtimeapi.StopContainerResponse{}, nil
+}
+
+func (s *fakeCRIServer) RemoveContainer(ctx context.Context, req *runtimeapi.RemoveContainerRequest) (*runtimeapi.RemoveContainerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.containers, req.ContainerId)
+	return &runtimeapi.RemoveContainerResponse{}, nil
+}
+
+func (s *fakeCRIServer) ListContainers(ctx context.Context, req *runtimeapi.ListContainersRequest) (*runtimeapi.ListContainersResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]*runtimeapi.Container, 0, len(s.containers))
+	for _, c := range s.containers {
+		state, _, _ := s.currentState(c)
+		snapshot := *c.Container
+		snapshot.State = state
+		items = append(items, &snapshot)
+	}
+	return &runtimeapi.ListContainersResponse{Containers: items}, nil
+}
+
+func (s *fakeCRIServer) ContainerStatus(ctx context.Context, req *runtimeapi.ContainerStatusRequest) (*runtimeapi.ContainerStatusResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.containers[req.ContainerId]
+	if !ok {
+		return nil, fmt.Errorf("no such container %q", req.ContainerId)
+	}
+	state, exitCode, reason := s.currentState(c)
+	return &runtimeapi.ContainerStatusResponse{
+		Status: &runtimeapi.ContainerStatus{
+			Id:       c.Id,
+			Metadata: c.Metadata,
+			State:    state,
+			ExitCode: exitCode,
+			Reason:   reason,
+			Image:    &runtimeapi.ImageSpec{Image: c.Image},
+		},
+	}, nil
+}
+
+// currentState asks the PodSimulator what c's state should be given how
+// long it has been running, unless c was explicitly stopped via
+// StopContainer, which always wins. Callers hold s.mu.
+func (s *fakeCRIServer) currentState(c *simContainer) (state runtimeapi.ContainerState, exitCode int32, reason string) {
+	if c.stopped {
+		return runtimeapi.ContainerState_CONTAINER_EXITED, 0, "Completed"
+	}
+	if c.pod == nil {
+		// No sandbox metadata to match distributions against (shouldn't
+		// happen outside of tests that skip RunPodSandbox); behave like an
+		// always-successful runtime.
+		return runtimeapi.ContainerState_CONTAINER_RUNNING, 0, ""
+	}
+	event, err := s.simulator.NextState(c.pod, c.Metadata.Name, time.Since(c.createdAt))
+	if err != nil {
+		klog.Errorf("fake CRI: simulator error for %s/%s: %v", c.pod.Name, c.Metadata.Name, err)
+		return c.State, 0, ""
+	}
+	switch event.Type {
+	case kubecontainer.ContainerDied:
+		return runtimeapi.ContainerState_CONTAINER_EXITED, int32(event.ExitCode), event.Reason
+	case kubecontainer.ContainerStarted:
+		return runtimeapi.ContainerState_CONTAINER_RUNNING, 0, ""
+	default:
+		return runtimeapi.ContainerState_CONTAINER_CREATED, 0, ""
+	}
+}
+
+func (s *fakeCRIServer) ListImages(ctx context.Context, req *runtimeapi.ListImagesRequest) (*runtimeapi.ListImagesResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]*runtimeapi.Image, 0, len(s.images))
+	for _, img := range s.images {
+		items = append(items, img)
+	}
+	return &runtimeapi.ListImagesResponse{Images: items}, nil
+}
+
+func (s *fakeCRIServer) ImageStatus(ctx context.Context, req *runtimeapi.ImageStatusRequest) (*runtimeapi.ImageStatusResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &runtimeapi.ImageStatusResponse{Image: s.images[req.Image.Image]}, nil
+}
+
+func (s *fakeCRIServer) PullImage(ctx context.Context, req *runtimeapi.PullImageRequest) (*runtimeapi.PullImageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref := req.Image.Image
+	s.images[ref] = &runtimeapi.Image{Id: ref, RepoTags: []string{ref}}
+	return &runtimeapi.PullImageResponse{ImageRef: ref}, nil
+}
+
+func (s *fakeCRIServer) RemoveImage(ctx context.Context, req *runtimeapi.RemoveImageRequest) (*runtimeapi.RemoveImageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.images, req.Image.Image)
+	return &runtimeapi.RemoveImageResponse{}, nil
+}
+
+func (s *fakeCRIServer) ImageFsInfo(ctx context.Context, req *runtimeapi.ImageFsInfoRequest) (*runtimeapi.ImageFsInfoResponse, error) {
+	return &runtimeapi.ImageFsInfoResponse{}, nil
+}
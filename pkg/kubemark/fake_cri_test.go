@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	runtimeapi "k8s.io/kubernetes/pkg/kubelet/apis/cri/runtime/v1alpha2"
+)
+
+func runPodSandboxAndContainer(t *testing.T, s *fakeCRIServer) (sandboxID, containerID string) {
+	t.Helper()
+	sandboxResp, err := s.RunPodSandbox(context.Background(), &runtimeapi.RunPodSandboxRequest{
+		Config: &runtimeapi.PodSandboxConfig{
+			Metadata: &runtimeapi.PodSandboxMetadata{Name: "pod", Namespace: "default", Uid: "uid-1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunPodSandbox: %v", err)
+	}
+	containerResp, err := s.CreateContainer(context.Background(), &runtimeapi.CreateContainerRequest{
+		PodSandboxId: sandboxResp.PodSandboxId,
+		Config: &runtimeapi.ContainerConfig{
+			Metadata: &runtimeapi.ContainerMetadata{Name: "c"},
+			Image:    &runtimeapi.ImageSpec{Image: "x"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	return sandboxResp.PodSandboxId, containerResp.ContainerId
+}
+
+func TestContainerStatusReflectsSimulatedOOMKill(t *testing.T) {
+	simulator := NewPodSimulator(&SimulatorConfig{
+		Distributions: []DistributionConfig{{ImageMatch: "*", OOMKillProbability: 1}},
+	})
+	s := newFakeCRIServer(simulator)
+	_, containerID := runPodSandboxAndContainer(t, s)
+
+	resp, err := s.ContainerStatus(context.Background(), &runtimeapi.ContainerStatusRequest{ContainerId: containerID})
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+	if resp.Status.State != runtimeapi.ContainerState_CONTAINER_EXITED || resp.Status.ExitCode != 137 || resp.Status.Reason != "OOMKilled" {
+		t.Errorf("expected an OOM-killed status, got %+v", resp.Status)
+	}
+}
+
+func TestStopContainerOverridesSimulatedState(t *testing.T) {
+	// OOMKillProbability 0 means the simulator would otherwise always report
+	// the container as running; StopContainer must still win.
+	simulator := NewPodSimulator(&SimulatorConfig{
+		Distributions: []DistributionConfig{{ImageMatch: "*", OOMKillProbability: 0}},
+	})
+	s := newFakeCRIServer(simulator)
+	_, containerID := runPodSandboxAndContainer(t, s)
+
+	if _, err := s.StopContainer(context.Background(), &runtimeapi.StopContainerRequest{ContainerId: containerID}); err != nil {
+		t.Fatalf("StopContainer: %v", err)
+	}
+
+	resp, err := s.ContainerStatus(context.Background(), &runtimeapi.ContainerStatusRequest{ContainerId: containerID})
+	if err != nil {
+		t.Fatalf("ContainerStatus: %v", err)
+	}
+	if resp.Status.State != runtimeapi.ContainerState_CONTAINER_EXITED || resp.Status.Reason != "Completed" {
+		t.Errorf("expected StopContainer to override the simulator's verdict, got %+v", resp.Status)
+	}
+
+	listResp, err := s.ListContainers(context.Background(), &runtimeapi.ListContainersRequest{})
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+	if len(listResp.Containers) != 1 || listResp.Containers[0].State != runtimeapi.ContainerState_CONTAINER_EXITED {
+		t.Errorf("expected ListContainers to also reflect the stopped state, got %+v", listResp.Containers)
+	}
+}
@@ -18,9 +18,13 @@ package kubemark
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
 	clientset "k8s.io/client-go/kubernetes"
 	kubeletapp "k8s.io/kubernetes/cmd/kubelet/app"
 	"k8s.io/kubernetes/cmd/kubelet/app/options"
@@ -31,6 +35,7 @@ import (
 	containertest "k8s.io/kubernetes/pkg/kubelet/container/testing"
 	"k8s.io/kubernetes/pkg/kubelet/dockershim"
 	kubetypes "k8s.io/kubernetes/pkg/kubelet/types"
+	utilflag "k8s.io/kubernetes/pkg/util/flag"
 	"k8s.io/kubernetes/pkg/util/mount"
 	"k8s.io/kubernetes/pkg/util/oom"
 	"k8s.io/kubernetes/pkg/volume/emptydir"
@@ -47,6 +52,15 @@ type HollowKubelet struct {
 	KubeletFlags         *options.KubeletFlags
 	KubeletConfiguration *kubeletconfig.KubeletConfiguration
 	KubeletDeps          *kubelet.Dependencies
+	// PodSimulator models PodLifecycleEvents for the hollow runtime in place
+	// of a real container runtime; see KubeletFlags.SimulatorConfig.
+	PodSimulator PodSimulator
+	// podLister backs the fake cadvisor and the /metrics handler with the
+	// set of pods the hollow kubelet currently knows about.
+	podLister *hollowPodLister
+	// MetricsBindAddress, if non-empty, is where Run starts the /metrics
+	// handler serving synthesized kubelet/cAdvisor metrics.
+	MetricsBindAddress string
 }
 
 func NewHollowKubelet(
@@ -56,7 +70,59 @@ func NewHollowKubelet(
 	heartbeatClient *clientset.Clientset,
 	cadvisorInterface cadvisor.Interface,
 	dockerClientConfig *dockershim.ClientConfig,
-	containerManager cm.ContainerManager) *HollowKubelet {
+	containerManager cm.ContainerManager,
+	metricsBindAddress string,
+	topology *NodeTopology,
+	podResourcesSocket string) *HollowKubelet {
+	// A nil containerManager means the caller wants the CPU/Memory manager
+	// simulator: NUMA-aware static CPU pinning driven by topology, reported
+	// back over the podresources API.
+	if containerManager == nil {
+		fcm := NewFakeContainerManager(topology)
+		if podResourcesSocket != "" {
+			if err := StartPodResourcesServer(podResourcesSocket, fcm.(*fakeContainerManager)); err != nil {
+				klog.Fatalf("Failed to start podresources server: %v", err)
+			}
+		}
+		containerManager = fcm
+	}
+	// The PodSimulator is constructed before the fake CRI server below since
+	// the fake CRI server consults it on every container state query.
+	var podSimulator PodSimulator
+	if flags.SimulatorConfig != "" {
+		simConfig, err := LoadSimulatorConfig(flags.SimulatorConfig)
+		if err != nil {
+			klog.Fatalf("Failed to load pod simulator config: %v", err)
+		}
+		podSimulator = NewPodSimulator(simConfig)
+	} else {
+		podSimulator = NewPodSimulator(nil)
+	}
+
+	// If the caller selected the fake CRI backend (flags.ContainerRuntime ==
+	// kubetypes.RemoteContainerRuntime), start an in-process CRI server and
+	// point the kubelet at it instead of dockershim, so hollow nodes exercise
+	// the same CRI code paths real nodes using containerd/CRI-O do.
+	if flags.ContainerRuntime == kubetypes.RemoteContainerRuntime {
+		if flags.RemoteRuntimeEndpoint == "" {
+			klog.Fatalf("RemoteRuntimeEndpoint must be set when ContainerRuntime is %q", kubetypes.RemoteContainerRuntime)
+		}
+		if err := StartFakeCRIServer(strings.TrimPrefix(flags.RemoteRuntimeEndpoint, "unix://"), podSimulator); err != nil {
+			klog.Fatalf("Failed to start fake CRI server: %v", err)
+		}
+		if flags.RemoteImageEndpoint == "" {
+			flags.RemoteImageEndpoint = flags.RemoteRuntimeEndpoint
+		}
+		dockerClientConfig = nil
+	}
+
+	// Fall back to a fake cadvisor (see NewFakeCadvisor) rather than leaving
+	// cAdvisor as a bare passthrough.
+	podLister := newHollowPodLister()
+	if cadvisorInterface == nil {
+		cadvisorInterface = NewFakeCadvisor(podLister)
+	}
+
 	// -----------------
 	// Injected objects
 	// -----------------
@@ -83,11 +149,22 @@ func NewHollowKubelet(
 		KubeletFlags:         flags,
 		KubeletConfiguration: config,
 		KubeletDeps:          d,
+		PodSimulator:         podSimulator,
+		podLister:            podLister,
+		MetricsBindAddress:   metricsBindAddress,
 	}
 }
 
+// podListerSyncPeriod is how often syncPodLister refreshes podLister's
+// snapshot of pods bound to this node.
+const podListerSyncPeriod = 10 * time.Second
+
 // Starts this HollowKubelet and blocks.
 func (hk *HollowKubelet) Run() {
+	go hk.syncPodLister()
+	if hk.MetricsBindAddress != "" {
+		ServeHollowMetrics(hk.MetricsBindAddress, hk.podLister, hk.KubeletDeps.CAdvisorInterface)
+	}
 	if err := kubeletapp.RunKubelet(&options.KubeletServer{
 		KubeletFlags:         *hk.KubeletFlags,
 		KubeletConfiguration: *hk.KubeletConfiguration,
@@ -97,6 +174,47 @@ func (hk *HollowKubelet) Run() {
 	select {}
 }
 
+// syncPodLister periodically refreshes podLister with the pods currently
+// bound to this node, so the fake cadvisor and /metrics handler reflect
+// actual pod churn on the hollow node instead of always reporting zero pods.
+// It also releases any CPUs the fake container manager pinned to pods that
+// have disappeared since the previous sync, since the hollow runtime has no
+// other signal for "this pod's containers are gone for good".
+func (hk *HollowKubelet) syncPodLister() {
+	fcm, _ := hk.KubeletDeps.ContainerManager.(*fakeContainerManager)
+	nodeName := hk.KubeletFlags.HostnameOverride
+	seen := map[types.UID]bool{}
+	for {
+		pods, err := hk.KubeletDeps.KubeClient.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		})
+		if err != nil {
+			klog.Errorf("Failed to list pods bound to %q: %v", nodeName, err)
+			time.Sleep(podListerSyncPeriod)
+			continue
+		}
+
+		podPtrs := make([]*v1.Pod, len(pods.Items))
+		stillSeen := map[types.UID]bool{}
+		for i := range pods.Items {
+			podPtrs[i] = &pods.Items[i]
+			stillSeen[pods.Items[i].UID] = true
+		}
+		hk.podLister.SetPods(podPtrs)
+
+		if fcm != nil {
+			for uid := range seen {
+				if !stillSeen[uid] {
+					fcm.ReleasePod(uid)
+				}
+			}
+		}
+		seen = stillSeen
+
+		time.Sleep(podListerSyncPeriod)
+	}
+}
+
 // Builds a KubeletConfiguration for the HollowKubelet, ensuring that the
 // usual defaults are applied for fields we do not override.
 func GetHollowKubeletConfig(
@@ -104,7 +222,11 @@ func GetHollowKubeletConfig(
 	kubeletPort int,
 	kubeletReadOnlyPort int,
 	maxPods int,
-	podsPerCore int) (*options.KubeletFlags, *kubeletconfig.KubeletConfiguration) {
+	podsPerCore int,
+	useFakeCRI bool,
+	nodeLeaseDurationSeconds int32,
+	dynamicConfigDir string,
+	topology *NodeTopology) (*options.KubeletFlags, *kubeletconfig.KubeletConfiguration) {
 
 	testRootDir := utils.MakeTempDirOrDie("hollow-kubelet.", "")
 	podFilePath := utils.MakeTempDirOrDie("static-pods", testRootDir)
@@ -121,6 +243,22 @@ func GetHollowKubeletConfig(
 	f.RegisterNode = true
 	f.RegisterSchedulable = true
 	f.ProviderID = fmt.Sprintf("kubemark://%v", nodeName)
+	if useFakeCRI {
+		// Exercise the same CRI-based code paths real nodes running
+		// containerd/CRI-O use, instead of dockershim, via the in-process
+		// fake CRI server started by NewHollowKubelet.
+		f.ContainerRuntime = kubetypes.RemoteContainerRuntime
+		f.RemoteRuntimeEndpoint = fmt.Sprintf("unix://%s/fake-cri.sock", testRootDir)
+	} else {
+		f.ContainerRuntime = kubetypes.DockerContainerRuntime
+	}
+	if dynamicConfigDir != "" {
+		// Subscribes this hollow node to a ConfigMap-backed
+		// KubeletConfiguration source, the same mechanism real kubelets use
+		// via --dynamic-config-dir, so kubemark can reproduce config
+		// rollout scenarios at scale.
+		f.DynamicConfigDir = utilflag.NewStringFlag(dynamicConfigDir)
+	}
 
 	// Config struct
 	c, err := options.NewKubeletConfiguration()
@@ -137,6 +275,22 @@ func GetHollowKubeletConfig(
 	c.HTTPCheckFrequency.Duration = 20 * time.Second
 	c.NodeStatusUpdateFrequency.Duration = 10 * time.Second
 	c.NodeStatusReportFrequency.Duration = time.Minute
+	if nodeLeaseDurationSeconds > 0 {
+		// Heartbeat via coordination.k8s.io Leases instead of full node status
+		// updates, matching the NodeLease feature real kubelets use at scale;
+		// NodeStatusReportFrequency still governs how often the fuller status
+		// is reconciled on top of the lease renewals.
+		//
+		// NewKubeletConfiguration doesn't guarantee FeatureGates is non-nil,
+		// so initialize it before writing rather than assuming it's already
+		// populated.
+		if c.FeatureGates == nil {
+			c.FeatureGates = map[string]bool{}
+		}
+		c.FeatureGates["NodeLease"] = true
+		c.NodeLeaseDurationSeconds = nodeLeaseDurationSeconds
+		c.NodeStatusUpdateFrequency.Duration = time.Duration(nodeLeaseDurationSeconds) * time.Second / 4
+	}
 	c.SyncFrequency.Duration = 10 * time.Second
 	c.EvictionPressureTransitionPeriod.Duration = 5 * time.Minute
 	c.MaxPods = int32(maxPods)
@@ -149,7 +303,14 @@ func GetHollowKubeletConfig(
 	c.CPUCFSQuota = true
 	c.EnableControllerAttachDetach = false
 	c.EnableDebuggingHandlers = true
-	c.CgroupsPerQOS = false
+	c.CgroupsPerQOS = topology != nil
+	if topology != nil {
+		// Report the static CPU manager policy instead of the default "none"
+		// policy when a simulated NUMA topology is given. The pinning
+		// decisions themselves (and podresources output) come from
+		// fakeContainerManager, which does not read this setting.
+		c.CPUManagerPolicy = "static"
+	}
 	// hairpin-veth is used to allow hairpin packets. Note that this deviates from
 	// what the "real" kubelet currently does, because there's no way to
 	// set promiscuous mode on docker0.
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	cadvisorapiv2 "github.com/google/cadvisor/info/v2"
+
+	"k8s.io/klog"
+	"k8s.io/kubernetes/pkg/kubelet/cadvisor"
+)
+
+// cadvisorV2RequestOptions selects all containers known to fakeCadvisor; the
+// fake implementation ignores filtering and always returns every container.
+var cadvisorV2RequestOptions = cadvisorapiv2.RequestOptions{}
+
+// hollowMetricsCollector publishes the subset of standard kubelet/cAdvisor
+// metrics families that scale tests poll (see NewFakeCadvisor), synthesized
+// from the hollow node's PodLister and fakeCadvisor rather than from a
+// real node.
+type hollowMetricsCollector struct {
+	pods     PodLister
+	cadvisor cadvisor.Interface
+
+	runningPods  *prometheus.Desc
+	podStart     *prometheus.Desc
+	plegRelist   *prometheus.Desc
+	runtimeOps   *prometheus.Desc
+	containerCPU *prometheus.Desc
+	containerMem *prometheus.Desc
+}
+
+func newHollowMetricsCollector(pods PodLister, cadvisorInterface cadvisor.Interface) *hollowMetricsCollector {
+	return &hollowMetricsCollector{
+		pods:     pods,
+		cadvisor: cadvisorInterface,
+		runningPods: prometheus.NewDesc(
+			"kubelet_running_pods", "Number of pods the hollow kubelet is currently running.", nil, nil),
+		podStart: prometheus.NewDesc(
+			"kubelet_pod_start_duration_seconds", "Simulated pod start latency.", nil, nil),
+		plegRelist: prometheus.NewDesc(
+			"kubelet_pleg_relist_duration_seconds", "Simulated PLEG relist latency.", nil, nil),
+		runtimeOps: prometheus.NewDesc(
+			"kubelet_runtime_operations_total", "Simulated cumulative runtime operation count.", []string{"operation_type"}, nil),
+		containerCPU: prometheus.NewDesc(
+			"container_cpu_usage_seconds_total", "Simulated cumulative CPU usage per container.", []string{"pod", "container"}, nil),
+		containerMem: prometheus.NewDesc(
+			"container_memory_working_set_bytes", "Simulated working set per container.", []string{"pod", "container"}, nil),
+	}
+}
+
+func (c *hollowMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.runningPods
+	ch <- c.podStart
+	ch <- c.plegRelist
+	ch <- c.runtimeOps
+	ch <- c.containerCPU
+	ch <- c.containerMem
+}
+
+func (c *hollowMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	pods := c.pods.GetPods()
+	ch <- prometheus.MustNewConstMetric(c.runningPods, prometheus.GaugeValue, float64(len(pods)))
+	// These two are near-instant for the hollow runtime; report a small
+	// constant so dashboards built against real kubelets render sensibly.
+	ch <- prometheus.MustNewConstMetric(c.podStart, prometheus.GaugeValue, 0.05)
+	ch <- prometheus.MustNewConstMetric(c.plegRelist, prometheus.GaugeValue, 0.01)
+	ch <- prometheus.MustNewConstMetric(c.runtimeOps, prometheus.CounterValue, float64(len(pods)), "create_container")
+
+	infos, err := c.cadvisor.ContainerInfoV2("/", cadvisorV2RequestOptions)
+	if err != nil {
+		klog.Errorf("hollow metrics: failed to collect container stats: %v", err)
+		return
+	}
+	for key, info := range infos {
+		if len(info.Stats) == 0 {
+			continue
+		}
+		latest := info.Stats[len(info.Stats)-1]
+		podName, container := splitContainerInfoKey(key)
+		ch <- prometheus.MustNewConstMetric(c.containerCPU, prometheus.CounterValue,
+			float64(latest.Cpu.Usage.Total)/1e9, podName, container)
+		ch <- prometheus.MustNewConstMetric(c.containerMem, prometheus.GaugeValue,
+			float64(latest.Memory.WorkingSet), podName, container)
+	}
+}
+
+// ServeHollowMetrics starts a /metrics HTTP handler on addr publishing
+// kubelet and cAdvisor-style metrics synthesized from pods and
+// cadvisorInterface. It returns immediately; the server runs in a
+// background goroutine for the lifetime of the process.
+func ServeHollowMetrics(addr string, pods PodLister, cadvisorInterface cadvisor.Interface) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newHollowMetricsCollector(pods, cadvisorInterface))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			klog.Errorf("Hollow metrics server on %s exited: %v", addr, err)
+		}
+	}()
+}
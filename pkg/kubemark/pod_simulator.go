@@ -0,0 +1,225 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+// PodSimulator is consulted by the hollow kubelet's fake CRI server (see
+// StartFakeCRIServer) each time container state is listed or queried, to
+// decide how a pod's containers should behave in lieu of a real container
+// runtime; with the dockershim backend it is not consulted. It
+// lets kubemark model realistic PodLifecycleEvents (image-pull latency,
+// start/stop delays, OOM kills, probe failures) so that components relying
+// on kubelet signals -- the scheduler, the eviction manager, the PLEG --
+// can be scale-tested against something more interesting than an immediate,
+// always-successful no-op runtime.
+type PodSimulator interface {
+	// NextState returns the lifecycle event the simulator wants to apply to
+	// containerName of pod, given how long it has been since the container
+	// was created. Implementations are expected to be
+	// deterministic for a given (pod, containerName, elapsed) so that replay
+	// and testing stay reproducible.
+	NextState(pod *v1.Pod, containerName string, elapsed time.Duration) (PodLifecycleEvent, error)
+}
+
+// PodLifecycleEvent describes a single state transition a PodSimulator wants
+// the hollow runtime to apply to a container. It mirrors the subset of
+// kubecontainer.PodLifecycleEvent information the hollow runtime needs to
+// fake PLEG relist output.
+type PodLifecycleEvent struct {
+	// Type is the kind of transition to apply (e.g. kubecontainer.ContainerStarted).
+	Type kubecontainer.PodLifeCycleEventType
+	// ExitCode is only meaningful when Type is ContainerDied; 0 means a clean
+	// exit, non-zero (including the conventional 137 for OOM) otherwise.
+	ExitCode int
+	// Reason is a short machine-readable string such as "OOMKilled" or
+	// "ImagePullBackOff", surfaced in the simulated container status.
+	Reason string
+}
+
+// DistributionConfig describes the simulated behavior for containers whose
+// pod matches ImageMatch (an exact image reference or "*" wildcard) and/or
+// LabelSelector (a standard label selector string, evaluated against the
+// pod's labels). The first matching entry in SimulatorConfig.Distributions
+// wins.
+type DistributionConfig struct {
+	// ImageMatch is matched against each container's image; "*" matches any
+	// image. Leave empty to match on LabelSelector alone.
+	ImageMatch string `json:"imageMatch,omitempty"`
+	// LabelSelector, if set, must match the pod's labels for this
+	// distribution to apply.
+	LabelSelector string `json:"labelSelector,omitempty"`
+
+	// ImagePullDuration is how long the simulator pretends image pulling
+	// takes before the container is reported as created.
+	ImagePullDuration metav1Duration `json:"imagePullDuration,omitempty"`
+	// StartDuration is how long after creation the container is reported
+	// running.
+	StartDuration metav1Duration `json:"startDuration,omitempty"`
+	// StopDuration is accepted in the config file but not applied: NextState
+	// does not read it, and the fake CRI server reports a stopped container
+	// as exited at once.
+	StopDuration metav1Duration `json:"stopDuration,omitempty"`
+
+	// OOMKillProbability is the chance, in [0,1], that a running container
+	// matching this distribution is killed with exit code 137 instead of
+	// running indefinitely.
+	OOMKillProbability float64 `json:"oomKillProbability,omitempty"`
+	// ProbeFailureProbability is the chance, in [0,1], that a container
+	// matching this distribution is deemed to have failed its liveness probe
+	// and is reported died (exit code 0, reason "Unhealthy") instead of
+	// running indefinitely.
+	ProbeFailureProbability float64 `json:"probeFailureProbability,omitempty"`
+}
+
+// metav1Duration is a small YAML-friendly duration, matching the
+// metav1.Duration convention used elsewhere in kubelet configuration so the
+// simulator config file reads like other component config (e.g. "30s").
+type metav1Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements json.Unmarshaler so metav1Duration fields can be
+// written as plain duration strings in the simulator config YAML.
+func (d *metav1Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// SimulatorConfig is the schema for the YAML file referenced by
+// KubeletFlags.SimulatorConfig. It holds an ordered list of per-image or
+// per-label-selector behavior distributions applied by the default
+// PodSimulator.
+type SimulatorConfig struct {
+	// Distributions are evaluated in order; the first one whose ImageMatch
+	// and LabelSelector (when set) both match wins. If none match, the
+	// simulator falls back to immediate, always-successful behavior.
+	Distributions []DistributionConfig `json:"distributions"`
+}
+
+// LoadSimulatorConfig reads and parses a SimulatorConfig from the YAML file
+// at path, as referenced by KubeletFlags.SimulatorConfig.
+func LoadSimulatorConfig(path string) (*SimulatorConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read simulator config %q: %v", path, err)
+	}
+	cfg := &SimulatorConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse simulator config %q: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// configuredPodSimulator is the default PodSimulator, driven by a
+// SimulatorConfig loaded from disk.
+type configuredPodSimulator struct {
+	config *SimulatorConfig
+}
+
+// NewPodSimulator returns a PodSimulator that drives container lifecycle
+// transitions from config. A nil config yields a simulator that behaves like
+// the previous no-op runtime (every container starts immediately and runs
+// forever), preserving existing hollow-node behavior when
+// KubeletFlags.SimulatorConfig is unset.
+func NewPodSimulator(config *SimulatorConfig) PodSimulator {
+	if config == nil {
+		config = &SimulatorConfig{}
+	}
+	return &configuredPodSimulator{config: config}
+}
+
+func (s *configuredPodSimulator) NextState(pod *v1.Pod, containerName string, elapsed time.Duration) (PodLifecycleEvent, error) {
+	image := ""
+	for _, c := range pod.Spec.Containers {
+		if c.Name == containerName {
+			image = c.Image
+			break
+		}
+	}
+	dist := s.distributionFor(pod, image)
+	switch {
+	case elapsed < dist.ImagePullDuration.Duration+dist.StartDuration.Duration:
+		// Still pulling the image or starting: created, not yet running.
+		return PodLifecycleEvent{Type: kubecontainer.ContainerChanged}, nil
+	case dist.OOMKillProbability > 0 && containerDiceRoll(pod, containerName, "oom") < dist.OOMKillProbability:
+		return PodLifecycleEvent{Type: kubecontainer.ContainerDied, ExitCode: 137, Reason: "OOMKilled"}, nil
+	case dist.ProbeFailureProbability > 0 && containerDiceRoll(pod, containerName, "probe") < dist.ProbeFailureProbability:
+		return PodLifecycleEvent{Type: kubecontainer.ContainerDied, ExitCode: 0, Reason: "Unhealthy"}, nil
+	default:
+		return PodLifecycleEvent{Type: kubecontainer.ContainerStarted}, nil
+	}
+}
+
+// containerDiceRoll returns a value in [0, 1) deterministically derived from
+// hashing (pod UID, containerName, salt). NextState uses it in place of a
+// fresh random draw so that whether a given container is one of the unlucky
+// ones (OOM-killed, failing its probe) is decided once per container instead
+// of being re-rolled -- and potentially flip-flopping -- on every call as
+// simulated time advances; different salts keep the independent dice rolls
+// (OOM vs. probe failure) from being correlated with each other.
+func containerDiceRoll(pod *v1.Pod, containerName, salt string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(string(pod.UID)))
+	h.Write([]byte("/"))
+	h.Write([]byte(containerName))
+	h.Write([]byte("/"))
+	h.Write([]byte(salt))
+	// Keep 53 bits so the division is exact and never rounds up to 1.
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
+
+// distributionFor returns the first configured distribution matching image
+// and pod's labels, or a zero-value distribution (immediate start, never
+// killed) if none match.
+func (s *configuredPodSimulator) distributionFor(pod *v1.Pod, image string) DistributionConfig {
+	for _, d := range s.config.Distributions {
+		if d.ImageMatch != "" && d.ImageMatch != "*" && d.ImageMatch != image {
+			continue
+		}
+		if d.LabelSelector != "" {
+			sel, err := labels.Parse(d.LabelSelector)
+			if err != nil || !sel.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+		}
+		return d
+	}
+	return DistributionConfig{}
+}
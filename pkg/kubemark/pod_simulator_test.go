@@ -0,0 +1,178 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubecontainer "k8s.io/kubernetes/pkg/kubelet/container"
+)
+
+func TestDistributionForMatchesImageAndLabelSelector(t *testing.T) {
+	config := &SimulatorConfig{
+		Distributions: []DistributionConfig{
+			{ImageMatch: "special:v1", OOMKillProbability: 1},
+			{LabelSelector: "tier=cache", StartDuration: metav1Duration{time.Second}},
+			{ImageMatch: "*"},
+		},
+	}
+	s := NewPodSimulator(config).(*configuredPodSimulator)
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"tier": "cache"}}}
+	if d := s.distributionFor(pod, "other:v1"); d.StartDuration.Duration != time.Second {
+		t.Errorf("expected the label-selector distribution to match, got %+v", d)
+	}
+
+	pod2 := &v1.Pod{}
+	if d := s.distributionFor(pod2, "special:v1"); d.OOMKillProbability != 1 {
+		t.Errorf("expected the image-match distribution to match, got %+v", d)
+	}
+
+	pod3 := &v1.Pod{}
+	if d := s.distributionFor(pod3, "unmatched:v1"); d.ImageMatch != "*" {
+		t.Errorf("expected the wildcard distribution to match, got %+v", d)
+	}
+}
+
+func TestNextStateProgressesThroughPullStartAndRuns(t *testing.T) {
+	config := &SimulatorConfig{
+		Distributions: []DistributionConfig{
+			{
+				ImageMatch:        "*",
+				ImagePullDuration: metav1Duration{10 * time.Second},
+				StartDuration:     metav1Duration{5 * time.Second},
+			},
+		},
+	}
+	s := NewPodSimulator(config)
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{Containers: []v1.Container{{Name: "c", Image: "x"}}},
+	}
+
+	event, err := s.NextState(pod, "c", 2*time.Second)
+	if err != nil {
+		t.Fatalf("NextState: %v", err)
+	}
+	if event.Type != kubecontainer.ContainerChanged {
+		t.Errorf("expected ContainerChanged while pulling, got %v", event.Type)
+	}
+
+	event, err = s.NextState(pod, "c", 12*time.Second)
+	if err != nil {
+		t.Fatalf("NextState: %v", err)
+	}
+	if event.Type != kubecontainer.ContainerChanged {
+		t.Errorf("expected ContainerChanged while starting, got %v", event.Type)
+	}
+
+	event, err = s.NextState(pod, "c", time.Hour)
+	if err != nil {
+		t.Fatalf("NextState: %v", err)
+	}
+	if event.Type != kubecontainer.ContainerStarted {
+		t.Errorf("expected ContainerStarted once running, got %v", event.Type)
+	}
+}
+
+func TestNextStateAlwaysOOMKillsWhenProbabilityIsOne(t *testing.T) {
+	config := &SimulatorConfig{
+		Distributions: []DistributionConfig{{ImageMatch: "*", OOMKillProbability: 1}},
+	}
+	s := NewPodSimulator(config)
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "c", Image: "x"}}}}
+
+	event, err := s.NextState(pod, "c", time.Hour)
+	if err != nil {
+		t.Fatalf("NextState: %v", err)
+	}
+	if event.Type != kubecontainer.ContainerDied || event.ExitCode != 137 || event.Reason != "OOMKilled" {
+		t.Errorf("expected an OOM-killed event, got %+v", event)
+	}
+}
+
+func TestNextStateAlwaysFailsProbeWhenProbabilityIsOne(t *testing.T) {
+	config := &SimulatorConfig{
+		Distributions: []DistributionConfig{{ImageMatch: "*", ProbeFailureProbability: 1}},
+	}
+	s := NewPodSimulator(config)
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "c", Image: "x"}}}}
+
+	event, err := s.NextState(pod, "c", time.Hour)
+	if err != nil {
+		t.Fatalf("NextState: %v", err)
+	}
+	if event.Type != kubecontainer.ContainerDied || event.ExitCode != 0 || event.Reason != "Unhealthy" {
+		t.Errorf("expected an unhealthy-probe event, got %+v", event)
+	}
+}
+
+func TestNextStateNeverOOMKillsWhenProbabilityIsZero(t *testing.T) {
+	config := &SimulatorConfig{
+		Distributions: []DistributionConfig{{ImageMatch: "*", OOMKillProbability: 0}},
+	}
+	s := NewPodSimulator(config)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{UID: "pod-1"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "c", Image: "x"}}},
+	}
+
+	event, err := s.NextState(pod, "c", time.Hour)
+	if err != nil {
+		t.Fatalf("NextState: %v", err)
+	}
+	if event.Type != kubecontainer.ContainerStarted {
+		t.Errorf("expected ContainerStarted with zero OOM probability, got %+v", event)
+	}
+}
+
+func TestNextStateIsStableAcrossRepeatedCalls(t *testing.T) {
+	// A mid-range probability means some (pod, container) pairs roll as
+	// doomed and some don't; the important thing is that repeated polls at
+	// growing elapsed times never disagree with themselves once a container
+	// has reached the running phase, matching the determinism NextState's
+	// doc comment promises. This guards against regressing to a fresh random
+	// draw (and therefore a flapping state) on every call.
+	config := &SimulatorConfig{
+		Distributions: []DistributionConfig{{ImageMatch: "*", OOMKillProbability: 0.5}},
+	}
+	s := NewPodSimulator(config)
+
+	for i := 0; i < 20; i++ {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{UID: types.UID(fmt.Sprintf("pod-%d", i))},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "c", Image: "x"}}},
+		}
+		first, err := s.NextState(pod, "c", time.Hour)
+		if err != nil {
+			t.Fatalf("NextState: %v", err)
+		}
+		for _, elapsed := range []time.Duration{2 * time.Hour, 3 * time.Hour, 24 * time.Hour} {
+			again, err := s.NextState(pod, "c", elapsed)
+			if err != nil {
+				t.Fatalf("NextState: %v", err)
+			}
+			if again.Type != first.Type || again.Reason != first.Reason {
+				t.Errorf("pod %d: NextState flapped between calls: first=%+v later=%+v", i, first, again)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"k8s.io/klog"
+	podresourcesapi "k8s.io/kubernetes/pkg/kubelet/apis/podresources/v1alpha1"
+)
+
+// podResourcesServer implements the podresources gRPC API (normally backed
+// by the real CPU/device manager) on top of fakeContainerManager's in-memory
+// CPU pinning table, so scheduler plugins, the TopologyManager and
+// NUMA-aware scale tests can inspect hollow-node allocations the same way
+// they would on real hardware.
+type podResourcesServer struct {
+	fcm *fakeContainerManager
+}
+
+// StartPodResourcesServer starts the podresources gRPC API on socketPath,
+// backed by fcm's current CPU pinning decisions. It returns immediately;
+// the server runs until the process exits.
+func StartPodResourcesServer(socketPath string, fcm *fakeContainerManager) error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clean up existing socket %q: %v", socketPath, err)
+	}
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %q: %v", socketPath, err)
+	}
+
+	server := grpc.NewServer()
+	podresourcesapi.RegisterPodResourcesListerServer(server, &podResourcesServer{fcm: fcm})
+	go func() {
+		if err := server.Serve(l); err != nil {
+			klog.Fatalf("Pod resources server exited: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *podResourcesServer) List(ctx context.Context, req *podresourcesapi.ListPodResourcesRequest) (*podresourcesapi.ListPodResourcesResponse, error) {
+	type podKey struct{ name, namespace string }
+	byPod := map[podKey][]*podresourcesapi.ContainerResources{}
+	var podUIDs []string
+	podKeys := map[string]podKey{}
+	for key, alloc := range s.fcm.Allocations() {
+		podUID, containerName := splitAllocationKey(key)
+		pk := podKey{name: alloc.podName, namespace: alloc.podNamespace}
+		if _, ok := podKeys[podUID]; !ok {
+			podUIDs = append(podUIDs, podUID)
+			podKeys[podUID] = pk
+		}
+		cpuIDs := make([]int64, len(alloc.cpuIDs))
+		for i, id := range alloc.cpuIDs {
+			cpuIDs[i] = int64(id)
+		}
+		byPod[pk] = append(byPod[pk], &podresourcesapi.ContainerResources{
+			Name:   containerName,
+			CpuIds: cpuIDs,
+		})
+	}
+
+	resp := &podresourcesapi.ListPodResourcesResponse{}
+	for _, podUID := range podUIDs {
+		pk := podKeys[podUID]
+		resp.PodResources = append(resp.PodResources, &podresourcesapi.PodResources{
+			Name:       pk.name,
+			Namespace:  pk.namespace,
+			Containers: byPod[pk],
+		})
+	}
+	return resp, nil
+}
+
+// splitAllocationKey reverses the "<pod UID>/<container name>" key format
+// used by fakeContainerManager.allocations.
+func splitAllocationKey(key string) (podUID, containerName string) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return key, ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	podresourcesapi "k8s.io/kubernetes/pkg/kubelet/apis/podresources/v1alpha1"
+)
+
+func TestPodResourcesListReportsNameAndNamespace(t *testing.T) {
+	fcm := NewFakeContainerManager(&NodeTopology{
+		NUMANodes: []NUMANodeTopology{{CoreCount: 2}},
+	}).(*fakeContainerManager)
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		UID:       types.UID("pod-1"),
+		Name:      "my-pod",
+		Namespace: "my-ns",
+	}}
+	container := guaranteedContainer("c", "2")
+	if _, err := fcm.GetResources(pod, &container, nil); err != nil {
+		t.Fatalf("GetResources: %v", err)
+	}
+
+	server := &podResourcesServer{fcm: fcm}
+	resp, err := server.List(nil, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(resp.PodResources) != 1 {
+		t.Fatalf("expected 1 pod in response, got %d", len(resp.PodResources))
+	}
+	got := resp.PodResources[0]
+	if got.Name != "my-pod" || got.Namespace != "my-ns" {
+		t.Errorf("got Name=%q Namespace=%q, want Name=%q Namespace=%q", got.Name, got.Namespace, "my-pod", "my-ns")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubemark
+
+// NodeTopology describes the simulated hardware of a single hollow node:
+// how many NUMA nodes (sockets) it has, how many CPU cores live on each,
+// how much hugepage memory is reserved per NUMA node, and what extended
+// devices (GPUs, NICs, ...) are attached where. NewFakeContainerManager
+// uses this to hand out NUMA-local CPU allocations the same way the real
+// CPU manager's "static" policy would, without requiring real hardware;
+// hugepages and devices only feed the node's reported capacity and are not
+// allocated per pod.
+type NodeTopology struct {
+	// NUMANodes describes each simulated NUMA node in socket order.
+	NUMANodes []NUMANodeTopology `json:"numaNodes"`
+}
+
+// NUMANodeTopology describes one simulated NUMA node.
+type NUMANodeTopology struct {
+	// CoreCount is the number of exclusive, schedulable CPU cores on this
+	// NUMA node.
+	CoreCount int `json:"coreCount"`
+	// HugepagesMB is the amount of hugepage memory, in MiB, reserved on
+	// this NUMA node.
+	HugepagesMB int64 `json:"hugepagesMB"`
+	// Devices are the extended resources (e.g. "nvidia.com/gpu") attached
+	// to this NUMA node, and how many of each are available.
+	Devices []DeviceTopology `json:"devices,omitempty"`
+}
+
+// DeviceTopology describes a set of identical extended-resource devices
+// local to a NUMA node.
+type DeviceTopology struct {
+	ResourceName string `json:"resourceName"`
+	Count        int    `json:"count"`
+}
+
+// TotalCores returns the number of CPU cores across all NUMA nodes.
+func (t *NodeTopology) TotalCores() int {
+	total := 0
+	for _, n := range t.NUMANodes {
+		total += n.CoreCount
+	}
+	return total
+}
+
+// DefaultNodeTopology is used when a hollow node is started without an
+// explicit --topology-config, giving it a single, modest NUMA node so the
+// CPU/memory manager simulator still has something to allocate from.
+func DefaultNodeTopology() *NodeTopology {
+	return &NodeTopology{
+		NUMANodes: []NUMANodeTopology{
+			{CoreCount: 4, HugepagesMB: 0},
+		},
+	}
+}